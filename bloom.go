@@ -0,0 +1,125 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// bloomSuffix names the sidecar file that holds a CDB's Bloom filter:
+// "<outfile>.bloom".
+const bloomSuffix = ".bloom"
+
+func bloomPath(cdbPath string) string {
+	return cdbPath + bloomSuffix
+}
+
+// bloom is a Bloom filter over the keys of a CDB, used to short-circuit
+// negative lookups without a header and hash table probe. It is built
+// from two independent hashes of each key (double hashing), per the
+// technique of Kirsch and Mitzenmacher.
+type bloom struct {
+	bits []byte
+	m    uint64 // number of bits
+	k    uint32 // number of hash functions
+}
+
+// newBloom sizes a filter for n keys at false positive rate p.
+func newBloom(n int, p float64) *bloom {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 1 {
+		m = 1
+	}
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloom{bits: make([]byte, (m+7)/8), m: m, k: k}
+}
+
+// h2 is the second of the two hashes used for double hashing, FNV-1a.
+func h2(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+func (b *bloom) add(h1, h2 uint64) {
+	for i := uint32(0); i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (b *bloom) mayContain(h1, h2 uint64) bool {
+	for i := uint32(0); i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHeaderSize is the size of the m/k prefix written before the bits
+// of a serialized filter.
+const bloomHeaderSize = 8 + 4
+
+var errShortBloom = errors.New("cdb: bloom sidecar is too short")
+
+// parseBloom reads a filter serialized by writeBloomFile back out of
+// data, without copying the bit array.
+func parseBloom(data []byte) (*bloom, error) {
+	if len(data) < bloomHeaderSize {
+		return nil, errShortBloom
+	}
+	m := binary.LittleEndian.Uint64(data)
+	k := binary.LittleEndian.Uint32(data[8:])
+	bits := data[bloomHeaderSize:]
+	if uint64(len(bits)) < (m+7)/8 {
+		return nil, errShortBloom
+	}
+	return &bloom{bits: bits, m: m, k: k}, nil
+}
+
+// writeBloomFile writes b to path, first writing a temp file in the
+// same directory and atomically renaming it into place.
+func writeBloomFile(path string, b *bloom) error {
+	buf := make([]byte, bloomHeaderSize+len(b.bits))
+	binary.LittleEndian.PutUint64(buf[0:8], b.m)
+	binary.LittleEndian.PutUint32(buf[8:12], b.k)
+	copy(buf[bloomHeaderSize:], b.bits)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(buf); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	name := tmp.Name()
+	tmp = nil
+	return os.Rename(name, path)
+}
@@ -0,0 +1,156 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func createBloomDB(t *testing.T, records []record, fpr float64) (*CDB, string) {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	f.Close()
+
+	err = CreateFile(name, &CreateOptions{BloomFPR: fpr}, func(w *Writer) error {
+		for _, rec := range records {
+			if err := w.Put(rec.key, rec.val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(bloomPath(name)); err != nil {
+		t.Fatalf("bloom sidecar %s: %v", bloomPath(name), err)
+	}
+
+	db, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, name
+}
+
+func TestBloomSidecar(t *testing.T) {
+	var records []record
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		val := []byte(fmt.Sprintf("val%d", i))
+		records = append(records, record{key, val})
+	}
+
+	db, name := createBloomDB(t, records, 0.01)
+	defer os.Remove(name)
+	defer os.Remove(bloomPath(name))
+	defer db.Close()
+
+	if db.bloom == nil {
+		t.Fatal("CDB has no Bloom filter loaded")
+	}
+
+	for i, rec := range records {
+		got, err := db.Data(rec.key)
+		if err != nil {
+			t.Errorf("[%d] Data(%v): %v", i, rec.key, err)
+			continue
+		}
+		if string(got) != string(rec.val) {
+			t.Errorf("[%d] Data(%v)=%v, want=%v", i, rec.key, got, rec.val)
+		}
+	}
+
+	_, err := db.Data([]byte("definitely-missing"))
+	if err != ErrNotFound {
+		t.Errorf("Data(missing): got err %v, want ErrNotFound", err)
+	}
+}
+
+func TestBloomDisable(t *testing.T) {
+	records := []record{{[]byte("a"), []byte("1")}}
+	_, name := createBloomDB(t, records, 0.01)
+	defer os.Remove(name)
+	defer os.Remove(bloomPath(name))
+
+	db, err := OpenFile(name, &OpenOptions{DisableBloom: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if db.bloom != nil {
+		t.Fatal("DisableBloom should prevent loading the sidecar")
+	}
+
+	got, err := db.Data([]byte("a"))
+	if err != nil || string(got) != "1" {
+		t.Fatalf("Data(a)=%v, %v, want 1, nil", got, err)
+	}
+}
+
+func BenchmarkDataHitHeavy(b *testing.B) {
+	benchmarkData(b, 0.01, true)
+}
+
+func BenchmarkDataMissHeavy(b *testing.B) {
+	benchmarkData(b, 0.01, false)
+}
+
+func benchmarkData(b *testing.B, fpr float64, hit bool) {
+	var records []record
+	for i := 0; i < 10000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		val := []byte(fmt.Sprintf("val%d", i))
+		records = append(records, record{key, val})
+	}
+
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+	defer os.Remove(bloomPath(name))
+
+	err = CreateFile(name, &CreateOptions{BloomFPR: fpr}, func(w *Writer) error {
+		for _, rec := range records {
+			if err := w.Put(rec.key, rec.val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	db, err := Open(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("key0")
+	if !hit {
+		key = []byte("not-present-at-all")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Data(key)
+	}
+}
@@ -6,16 +6,12 @@ package cdb
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"runtime"
-	"strings"
-	"syscall"
 )
 
 const slotWidth = 8
@@ -25,67 +21,54 @@ const headerSize = nHeaders * headerWidth
 
 // CDB is an open constant database file
 type CDB struct {
-	header [nHeaders]tablePointer
-	data   []byte
+	format      format
+	header      [nHeaders]tablePointer
+	data        []byte
+	mapped      bool
+	bloom       *bloom
+	bloomData   []byte
+	bloomMapped bool
+}
+
+// OpenOptions controls optional behavior of OpenFile.
+type OpenOptions struct {
+	// DisableMmap causes OpenFile to read the whole file into memory
+	// instead of memory-mapping it. Use this for filesystems that do not
+	// support mmap (some network mounts, for example).
+	DisableMmap bool
+
+	// Format selects the on-disk variant to read. The zero value,
+	// Format32, is the original CDB format. Use Format64 to read a file
+	// written by Create64 or NewWriter64.
+	Format Format
+
+	// DisableBloom skips loading a Bloom filter sidecar even if one is
+	// present next to the CDB file.
+	DisableBloom bool
+
+	// Lock takes a shared advisory lock on the file while OpenFile reads
+	// or maps it, so OpenFile never sees a file a concurrent
+	// CreateFile(opts.Lock=true) is still writing. Pair this with
+	// CreateOptions.Lock.
+	Lock bool
 }
 
 type tablePointer struct {
-	pos    uint32
-	nslots uint32
+	pos    uint64
+	nslots uint64
 }
 
 var errShortFile = errors.New("file is too short for a CDB")
 
-// Create writes a new CDB file to outfile. The file is first written to a
-// temp file and atomically renamed. The external program "cdb" must be
-// in your PATH.
-//
-// The creator callback should write records created with AppendRecord to
-// the provided io.Writer.
-func Create(outfile string, creator func(io.Writer) error) error {
-	cdbCmd := exec.Command("cdb", "-c", outfile)
-	cdbPipe, err := cdbCmd.StdinPipe()
-	if err != nil {
-		return nil
-	}
-
-	err = cdbCmd.Start()
-	if err != nil {
-		return err
-	}
-
-	var errs []string
-
-	err = creator(cdbPipe)
-	if err != nil {
-		errs = append(errs, err.Error())
-	}
-
-	// complete the CDB records
-	_, err = cdbPipe.Write([]byte("\n"))
-	if err != nil {
-		return err
-	}
-
-	err = cdbPipe.Close()
-	if err != nil {
-		errs = append(errs, "cdb close: "+err.Error())
-	}
-
-	err = cdbCmd.Wait()
-	if err != nil {
-		errs = append(errs, "cdb wait: "+err.Error())
-	}
-
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "\n"))
-	}
-
-	return nil
+// Open creates and returns a CDB from file, using the default options.
+func Open(file string) (*CDB, error) {
+	return OpenFile(file, nil)
 }
 
-// Open creates and returns a CDB from file.
-func Open(file string) (*CDB, error) {
+// OpenFile creates and returns a CDB from file, as Open does, but accepts
+// OpenOptions to control optional behavior such as disabling mmap or
+// reading the 64-bit cdb64 variant.
+func OpenFile(file string, opts *OpenOptions) (*CDB, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
@@ -93,6 +76,13 @@ func Open(file string) (*CDB, error) {
 	// it is OK to close a file after mapping it
 	defer f.Close()
 
+	if opts != nil && opts.Lock {
+		if err := lockFile(f, false); err != nil {
+			return nil, err
+		}
+		defer unlockFile(f)
+	}
+
 	fi, err := f.Stat()
 	if err != nil {
 		return nil, err
@@ -105,35 +95,123 @@ func Open(file string) (*CDB, error) {
 		return &CDB{}, nil
 	}
 
-	if fi.Size() < headerSize {
+	var fm Format
+	if opts != nil {
+		fm = opts.Format
+	}
+	format := formatFor(fm)
+
+	if fi.Size() < int64(format.headerSize) {
 		return nil, errShortFile
 	}
 
-	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()),
-		syscall.PROT_READ, syscall.MAP_PRIVATE)
-	if err != nil {
-		return nil, err
+	var data []byte
+	mapped := false
+	if opts == nil || !opts.DisableMmap {
+		data, err = mmap(f, int(fi.Size()))
+		mapped = err == nil
+	}
+
+	if !mapped {
+		// either mmap was disabled or it failed (e.g. on a filesystem
+		// that does not support it); fall back to reading the whole file.
+		data = make([]byte, fi.Size())
+		if _, err := io.ReadFull(f, data); err != nil {
+			return nil, err
+		}
 	}
 
 	db := &CDB{
-		data: data,
+		format: format,
+		data:   data,
+		mapped: mapped,
 	}
 
-	// munmap when the reference is released
-	runtime.SetFinalizer(db, (*CDB).Close)
+	if mapped {
+		// munmap when the reference is released
+		runtime.SetFinalizer(db, (*CDB).Close)
+	}
 
 	db.readHeader(data)
 
+	if opts == nil || !opts.DisableBloom {
+		db.loadBloom(file)
+	}
+
 	return db, nil
 }
 
+// loadBloom loads the Bloom filter sidecar for file, if one exists and
+// is not older than file itself (an older sidecar may not reflect
+// file's current keys, so it is ignored rather than risk a false
+// negative). Neither a missing or older sidecar nor an unusable one
+// (unreadable, corrupt) is an error: a missing or older one is skipped
+// silently, an unusable one is logged, and in every case db simply falls
+// back to always probing the hash table.
+func (db *CDB) loadBloom(file string) {
+	path := bloomPath(file)
+
+	bf, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("cdb: opening bloom sidecar %s: %v", path, err)
+		return
+	}
+	defer bf.Close()
+
+	fi, err := bf.Stat()
+	if err != nil {
+		log.Printf("cdb: stat bloom sidecar %s: %v", path, err)
+		return
+	}
+
+	if mainFi, err := os.Stat(file); err == nil && fi.ModTime().Before(mainFi.ModTime()) {
+		return
+	}
+
+	data, err := mmap(bf, int(fi.Size()))
+	mapped := err == nil
+	if !mapped {
+		// fall back to a plain read if mmap is unavailable
+		data = make([]byte, fi.Size())
+		if _, err := io.ReadFull(bf, data); err != nil {
+			log.Printf("cdb: reading bloom sidecar %s: %v", path, err)
+			return
+		}
+	}
+
+	b, err := parseBloom(data)
+	if err != nil {
+		log.Printf("cdb: parsing bloom sidecar %s: %v", path, err)
+		if mapped {
+			munmap(data)
+		}
+		return
+	}
+
+	db.bloom = b
+	db.bloomData = data
+	db.bloomMapped = mapped
+}
+
 // Close releases resources associated with this CDB.
 func (db *CDB) Close() error {
 	var err error
-	if db.data != nil {
-		err = syscall.Munmap(db.data)
+	if db.data != nil && db.mapped {
+		err = munmap(db.data)
 	}
 	db.data = nil
+
+	if db.bloomData != nil && db.bloomMapped {
+		if berr := munmap(db.bloomData); err == nil {
+			err = berr
+		}
+	}
+	db.bloomData = nil
+	db.bloom = nil
+
 	return err
 }
 
@@ -158,41 +236,46 @@ func (db *CDB) Data(key []byte) (val []byte, err error) {
 		}
 	}()
 
-	hashcode := uint32(5381)
-	for _, c := range key {
-		hashcode = ((hashcode << 5) + hashcode) ^ uint32(c)
+	hashcode := uint64(hashKey(key))
+
+	if db.bloom != nil && !db.bloom.mayContain(hashcode, h2(key)) {
+		return nil, ErrNotFound
 	}
 
+	fw := uint64(db.format.fieldWidth)
+	sw := uint64(db.format.slotWidth)
+
 	header := db.header[hashcode&0xff]
 	if header.nslots == 0 {
 		return nil, ErrNotFound
 	}
 
-	table := db.data[header.pos : header.pos+header.nslots*slotWidth]
+	table := db.data[header.pos : header.pos+header.nslots*sw]
 
-	slot := ((hashcode >> 8) % header.nslots) * slotWidth
+	slot := ((hashcode >> 8) % header.nslots) * sw
 
 	// prevent endless loops if no slots are empty
-	for i := uint32(0); i < header.nslots; i++ {
-		hash := binary.LittleEndian.Uint32(table[slot:])
-		pos := binary.LittleEndian.Uint32(table[slot+4:])
+	for i := uint64(0); i < header.nslots; i++ {
+		hash := db.format.getUint(table[slot:])
+		pos := db.format.getUint(table[slot+fw:])
 		if pos == 0 {
 			return nil, ErrNotFound
 		}
 		if hash == hashcode {
 			record := db.data[pos:]
-			keyLen := binary.LittleEndian.Uint32(record)
-			dataLen := binary.LittleEndian.Uint32(record[4:])
-			recKey := record[8 : 8+keyLen]
+			keyLen := db.format.getUint(record)
+			dataLen := db.format.getUint(record[fw:])
+			recHeader := 2 * fw
+			recKey := record[recHeader : recHeader+keyLen]
 			if bytes.Equal(key, recKey) {
-				data := record[8+keyLen : 8+keyLen+dataLen]
+				data := record[recHeader+keyLen : recHeader+keyLen+dataLen]
 				return data, nil
 			}
 		}
 
 		// search next slot, wrapping around
-		slot += slotWidth
-		if slot >= uint32(len(table)) {
+		slot += sw
+		if slot >= uint64(len(table)) {
 			slot = 0
 		}
 	}
@@ -202,9 +285,19 @@ func (db *CDB) Data(key []byte) (val []byte, err error) {
 
 // readHeader populates db.header from data
 func (db *CDB) readHeader(data []byte) {
+	fw := uint64(db.format.fieldWidth)
 	for i := range db.header {
-		db.header[i].pos = binary.LittleEndian.Uint32(data)
-		db.header[i].nslots = binary.LittleEndian.Uint32(data[4:])
-		data = data[headerWidth:]
+		db.header[i].pos = db.format.getUint(data)
+		db.header[i].nslots = db.format.getUint(data[fw:])
+		data = data[db.format.headerWidth:]
+	}
+}
+
+// hashKey computes the djb2-XOR hash used throughout the CDB format.
+func hashKey(key []byte) uint32 {
+	hashcode := uint32(5381)
+	for _, c := range key {
+		hashcode = ((hashcode << 5) + hashcode) ^ uint32(c)
 	}
+	return hashcode
 }
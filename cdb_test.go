@@ -7,7 +7,6 @@ package cdb
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -92,6 +91,152 @@ func TestReadProtection(t *testing.T) {
 	}
 }
 
+func TestAll(t *testing.T) {
+	key := []byte("dup")
+	vals := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+
+	records := []record{
+		{key, vals[0]},
+		{[]byte("other"), []byte("value")},
+		{key, vals[1]},
+		{key, vals[2]},
+	}
+
+	db := createDB(records)
+
+	got, err := db.All(key)
+	if err != nil {
+		t.Fatalf("All(%v): %v", key, err)
+	}
+	if len(got) != len(vals) {
+		t.Fatalf("All(%v)=%v, want %v", key, got, vals)
+	}
+	for i, v := range vals {
+		if !bytes.Equal(got[i], v) {
+			t.Errorf("All(%v)[%d]=%v, want=%v", key, i, got[i], v)
+		}
+	}
+
+	_, err = db.All([]byte("missing"))
+	if err != ErrNotFound {
+		t.Errorf("All(missing): got err %v, want ErrNotFound", err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	var records []record
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		val := []byte(fmt.Sprintf("val%d", i))
+		records = append(records, record{key, val})
+	}
+
+	db := createDB(records)
+
+	var got []record
+	err := db.Iterate(func(key, value []byte) error {
+		got = append(got, record{append([]byte(nil), key...), append([]byte(nil), value...)})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Iterate: %v", err)
+	}
+
+	if len(got) != len(records) {
+		t.Fatalf("Iterate visited %d records, want %d", len(got), len(records))
+	}
+	for i, rec := range records {
+		if !bytes.Equal(got[i].key, rec.key) || !bytes.Equal(got[i].val, rec.val) {
+			t.Errorf("[%d] Iterate got %v, want %v", i, got[i], rec)
+		}
+	}
+}
+
+func TestFormat64(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []record
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		val := []byte(fmt.Sprintf("val%d", i))
+		records = append(records, record{key, val})
+	}
+
+	err = Create64(f.Name(), func(w *Writer) error {
+		for _, rec := range records {
+			if err := w.Put(rec.key, rec.val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenFile(f.Name(), &OpenOptions{Format: Format64})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, rec := range records {
+		got, err := db.Data(rec.key)
+		if err != nil {
+			t.Errorf("[%d] Data(%v): %v", i, rec.key, err)
+			continue
+		}
+		if !bytes.Equal(got, rec.val) {
+			t.Errorf("[%d] Data(%v)=%v, want=%v", i, rec.key, got, rec.val)
+		}
+	}
+
+	_, err = db.Data([]byte("missing"))
+	if err != ErrNotFound {
+		t.Errorf("Data(missing): got err %v, want ErrNotFound", err)
+	}
+}
+
+func TestDisableMmap(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := record{[]byte("key"), []byte("value")}
+	err = Create(f.Name(), func(w *Writer) error {
+		return w.Put(rec.key, rec.val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenFile(f.Name(), &OpenOptions{DisableMmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Data(rec.key)
+	if err != nil {
+		t.Fatalf("Data(%v): %v", rec.key, err)
+	}
+	if !bytes.Equal(got, rec.val) {
+		t.Errorf("Data(%v)=%v, want=%v", rec.key, got, rec.val)
+	}
+}
+
 type record struct {
 	key, val []byte
 }
@@ -106,12 +251,9 @@ func createDB(records []record) *CDB {
 		panic(err)
 	}
 
-	err = Create(f.Name(), func(w io.Writer) error {
-		data := make([]byte, 0, 8192)
+	err = Create(f.Name(), func(w *Writer) error {
 		for _, rec := range records {
-			data = data[:0]
-			data = AppendRecord(data, []byte(rec.key), []byte(rec.val))
-			_, err = w.Write(data)
+			err = w.Put(rec.key, rec.val)
 			if err != nil {
 				return err
 			}
@@ -138,14 +280,12 @@ func Example() {
 	defer tmp.Close()
 	defer os.Remove(tmp.Name())
 
-	err = Create(tmp.Name(), func(cdbPipe io.Writer) error {
-		buf := make([]byte, 0, 8192)
+	err = Create(tmp.Name(), func(w *Writer) error {
 		for key, value := range map[string]string{
 			"a": "123",
 			"b": "456",
 		} {
-			buf = AppendRecord(buf[:0], []byte(key), []byte(value))
-			_, err := cdbPipe.Write(buf)
+			err := w.Put([]byte(key), []byte(value))
 			if err != nil {
 				return err
 			}
@@ -9,10 +9,25 @@
 // large data sets out of the heap so they will not impact the
 // performance of the Go garbage collector.
 //
-// The data is loaded using mmap(2) and shared copies are returned,
-// which is why the data must be read-only.
+// The data is loaded by memory-mapping the file (on Unix and Windows)
+// and shared copies are returned, which is why the data must be
+// read-only. OpenFile can disable mmap and read the whole file into
+// memory instead, for filesystems that do not support it.
 //
-// The package delegates creation of CDB files to an external "cdb"
-// utility, which must be installed. Both Bernstein's original cdb
-// and TinyCDB (http://www.corpit.ru/mjt/tinycdb.html) may be used.
+// CDB files are written with a pure Go implementation of the format, so
+// no external tools are required to create them.
+//
+// The original format is limited to files just under 4 GiB, since its
+// header and hash table fields are 32 bits wide. Create64 and
+// NewWriter64 write the 64-bit "cdb64" variant instead, which lifts that
+// limit; OpenFile with OpenOptions{Format: Format64} reads it back.
+//
+// Reloader serves a CDB that can be swapped for a newer version of the
+// same file while readers are using it, for deployments that
+// periodically regenerate the database in place.
+//
+// For workloads with a high miss rate, CreateOptions.BloomFPR builds a
+// Bloom filter sidecar next to the CDB file, which OpenFile loads
+// automatically; Data then skips the header and hash table probe
+// entirely on a negative.
 package cdb
@@ -0,0 +1,64 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import "encoding/binary"
+
+// Format selects an on-disk CDB variant.
+type Format int
+
+const (
+	// Format32 is D. J. Bernstein's original CDB format. Header and hash
+	// table fields are 32 bits wide, which limits files to just under
+	// 4 GiB.
+	Format32 Format = iota
+
+	// Format64 is the "cdb64" extension: the same layout as Format32,
+	// but every header, hash table and record length field is 64 bits
+	// wide, lifting the 4 GiB limit.
+	Format64
+)
+
+// format holds the field widths and encode/decode functions that
+// parameterize the CDB layout for a given Format. It is resolved once,
+// at Open or NewWriter time, so the hot lookup and write paths never
+// branch on the format themselves.
+type format struct {
+	fieldWidth  uint32 // width in bytes of a single length/offset field
+	slotWidth   uint32 // width of a (hash, pos) hash table slot
+	headerWidth uint32 // width of a (pos, nslots) header entry
+	headerSize  uint32 // headerWidth * nHeaders
+
+	getUint func(b []byte) uint64
+	putUint func(b []byte, v uint64)
+}
+
+var format32 = format{
+	fieldWidth:  slotWidth / 2,
+	slotWidth:   slotWidth,
+	headerWidth: headerWidth,
+	headerSize:  headerSize,
+
+	getUint: func(b []byte) uint64 { return uint64(binary.LittleEndian.Uint32(b)) },
+	putUint: func(b []byte, v uint64) { binary.LittleEndian.PutUint32(b, uint32(v)) },
+}
+
+var format64 = format{
+	fieldWidth:  16 / 2,
+	slotWidth:   16,
+	headerWidth: 16,
+	headerSize:  nHeaders * 16,
+
+	getUint: func(b []byte) uint64 { return binary.LittleEndian.Uint64(b) },
+	putUint: func(b []byte, v uint64) { binary.LittleEndian.PutUint64(b, v) },
+}
+
+// formatFor resolves the format for f, defaulting to Format32.
+func formatFor(f Format) format {
+	if f == Format64 {
+		return format64
+	}
+	return format32
+}
@@ -0,0 +1,132 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime"
+)
+
+// All returns every value stored under key, in hash table probe order.
+// CDB permits more than one record to share a key; Data only ever
+// returns the first. If no record matches key, All returns ErrNotFound.
+func (db *CDB) All(key []byte) (vals [][]byte, err error) {
+	// catch array range checks, etc.
+	defer func() {
+		if val := recover(); val != nil {
+			const size = 4096
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Printf("cdb: panic finding %v: %v\n%s", key, val, buf)
+			// set named return value
+			if perr, ok := val.(error); ok {
+				err = perr
+			} else {
+				err = fmt.Errorf("cdb: panic in find: %v", val)
+			}
+		}
+	}()
+
+	hashcode := uint64(hashKey(key))
+	fw := uint64(db.format.fieldWidth)
+	sw := uint64(db.format.slotWidth)
+
+	header := db.header[hashcode&0xff]
+	if header.nslots == 0 {
+		return nil, ErrNotFound
+	}
+
+	table := db.data[header.pos : header.pos+header.nslots*sw]
+
+	slot := ((hashcode >> 8) % header.nslots) * sw
+
+	// prevent endless loops if no slots are empty
+	for i := uint64(0); i < header.nslots; i++ {
+		hash := db.format.getUint(table[slot:])
+		pos := db.format.getUint(table[slot+fw:])
+		if pos == 0 {
+			break
+		}
+		if hash == hashcode {
+			record := db.data[pos:]
+			keyLen := db.format.getUint(record)
+			dataLen := db.format.getUint(record[fw:])
+			recHeader := 2 * fw
+			recKey := record[recHeader : recHeader+keyLen]
+			if bytes.Equal(key, recKey) {
+				vals = append(vals, record[recHeader+keyLen:recHeader+keyLen+dataLen])
+			}
+		}
+
+		// search next slot, wrapping around
+		slot += sw
+		if slot >= uint64(len(table)) {
+			slot = 0
+		}
+	}
+
+	if len(vals) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return vals, nil
+}
+
+// Iterate scans every record in the database, in the order it was
+// written, calling fn with each key and value. The key and value slices
+// are zero-copy sub-slices of the underlying file data; they must not be
+// modified, and must not be retained past the call to fn.
+//
+// If fn returns an error, Iterate stops and returns that error.
+func (db *CDB) Iterate(fn func(key, value []byte) error) (err error) {
+	// catch array range checks, etc.
+	defer func() {
+		if val := recover(); val != nil {
+			const size = 4096
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Printf("cdb: panic iterating: %v\n%s", val, buf)
+			// set named return value
+			if perr, ok := val.(error); ok {
+				err = perr
+			} else {
+				err = fmt.Errorf("cdb: panic in iterate: %v", val)
+			}
+		}
+	}()
+
+	if len(db.data) == 0 {
+		return nil
+	}
+
+	fw := uint64(db.format.fieldWidth)
+	recHeader := 2 * fw
+
+	// the record region ends where the first hash table begins
+	end := uint64(len(db.data))
+	for _, h := range db.header {
+		if h.pos < end {
+			end = h.pos
+		}
+	}
+
+	for pos := uint64(db.format.headerSize); pos < end; {
+		record := db.data[pos:]
+		keyLen := db.format.getUint(record)
+		dataLen := db.format.getUint(record[fw:])
+		key := record[recHeader : recHeader+keyLen]
+		value := record[recHeader+keyLen : recHeader+keyLen+dataLen]
+
+		if err := fn(key, value); err != nil {
+			return err
+		}
+
+		pos += recHeader + keyLen + dataLen
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package cdb
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f read-only and private, so writes to
+// the returned slice fault rather than reaching the file.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+// munmap releases a mapping returned by mmap.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,127 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// reloadGrace is how long Reload waits before closing the CDB it
+// replaced, so that Data calls already in flight against it keep
+// reading from valid mmap memory.
+const reloadGrace = 5 * time.Second
+
+// Reloader serves a CDB that can be swapped for a newer version of the
+// same file while readers are using it, for deployments that
+// periodically regenerate the database and want to hot-swap it in.
+type Reloader struct {
+	path    string
+	opts    *OpenOptions
+	current atomic.Pointer[CDB]
+	stop    chan struct{}
+}
+
+// NewReloader opens path and returns a Reloader serving it. opts is
+// passed to OpenFile on every reload; it may be nil.
+func NewReloader(path string, opts *OpenOptions) (*Reloader, error) {
+	db, err := OpenFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{
+		path: path,
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+	r.current.Store(db)
+	return r, nil
+}
+
+// Get returns the CDB currently being served.
+func (r *Reloader) Get() *CDB {
+	return r.current.Load()
+}
+
+// Data delegates to the currently served CDB's Data method.
+func (r *Reloader) Data(key []byte) ([]byte, error) {
+	return r.Get().Data(key)
+}
+
+// Reload re-opens the file at r's path and atomically swaps it in. The
+// CDB it replaces is closed after reloadGrace, rather than immediately,
+// so Data calls already in flight against it are not reading from
+// unmapped memory.
+//
+// Reload takes a shared advisory lock on the file while opening it, so
+// it never maps a file a concurrent CreateFile(opts.Lock=true) is still
+// writing.
+func (r *Reloader) Reload() error {
+	opts := OpenOptions{}
+	if r.opts != nil {
+		opts = *r.opts
+	}
+	opts.Lock = true
+
+	db, err := OpenFile(r.path, &opts)
+	if err != nil {
+		return err
+	}
+
+	old := r.current.Swap(db)
+	if old != nil {
+		time.AfterFunc(reloadGrace, func() {
+			old.Close()
+		})
+	}
+
+	return nil
+}
+
+// Watch polls r's path for a change in modification time every interval,
+// calling Reload whenever it changes. It blocks until Close is called.
+func (r *Reloader) Watch(interval time.Duration) error {
+	var lastMod time.Time
+	if fi, err := os.Stat(r.path); err == nil {
+		lastMod = fi.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return nil
+		case <-ticker.C:
+			fi, err := os.Stat(r.path)
+			if err != nil {
+				continue
+			}
+			if fi.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = fi.ModTime()
+
+			if err := r.Reload(); err != nil {
+				log.Printf("cdb: reload %s: %v", r.path, err)
+			}
+		}
+	}
+}
+
+// Close stops any running Watch loop and closes the currently served
+// CDB.
+func (r *Reloader) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	return r.Get().Close()
+}
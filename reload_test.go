@@ -0,0 +1,191 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeDB(t *testing.T, path string, records []record) {
+	t.Helper()
+	err := Create(path, func(w *Writer) error {
+		for _, rec := range records {
+			if err := w.Put(rec.key, rec.val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloaderReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	key := []byte("k")
+	writeDB(t, f.Name(), []record{{key, []byte("v1")}})
+
+	r, err := NewReloader(f.Name(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	got, err := r.Data(key)
+	if err != nil {
+		t.Fatalf("Data(%v): %v", key, err)
+	}
+	if !bytes.Equal(got, []byte("v1")) {
+		t.Fatalf("Data(%v)=%v, want v1", key, got)
+	}
+
+	writeDB(t, f.Name(), []record{{key, []byte("v2")}})
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	got, err = r.Data(key)
+	if err != nil {
+		t.Fatalf("Data(%v): %v", key, err)
+	}
+	if !bytes.Equal(got, []byte("v2")) {
+		t.Fatalf("Data(%v)=%v, want v2", key, got)
+	}
+}
+
+// TestReloaderReloadBlocksOnLock proves Reload's shared lock actually
+// contends with a writer's exclusive lock, rather than merely relying on
+// CreateFile's temp-file-plus-rename already making partial writes
+// invisible to readers (which would make Reload return instantly no
+// matter what the lock does). It holds the writer's lock for a while
+// after the rename that swaps in the new data, and checks that Reload
+// blocks for at least that long before returning.
+func TestReloaderReloadBlocksOnLock(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	key := []byte("k")
+	writeDB(t, name, []record{{key, []byte("v1")}})
+
+	r, err := NewReloader(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	const delay = 200 * time.Millisecond
+	renamed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name))
+		if err != nil {
+			t.Error(err)
+			close(renamed)
+			return
+		}
+		defer tmp.Close()
+
+		if err := lockFile(tmp, true); err != nil {
+			t.Error(err)
+			close(renamed)
+			return
+		}
+		defer unlockFile(tmp)
+
+		w := NewWriter(tmp)
+		if err := w.Put(key, []byte("v2")); err != nil {
+			t.Error(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := tmp.Sync(); err != nil {
+			t.Error(err)
+		}
+		if err := os.Rename(tmp.Name(), name); err != nil {
+			t.Error(err)
+		}
+		close(renamed)
+
+		// still holding the exclusive lock on the now-renamed file: a
+		// concurrent Reload must block here, not just on the rename.
+		time.Sleep(delay)
+	}()
+
+	<-renamed
+
+	start := time.Now()
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	elapsed := time.Since(start)
+	<-done
+
+	if elapsed < delay {
+		t.Fatalf("Reload returned after %v while the writer held its lock for %v; Reload should have blocked", elapsed, delay)
+	}
+
+	got, err := r.Data(key)
+	if err != nil {
+		t.Fatalf("Data(%v): %v", key, err)
+	}
+	if !bytes.Equal(got, []byte("v2")) {
+		t.Fatalf("Data(%v)=%v, want v2", key, got)
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	key := []byte("k")
+	writeDB(t, f.Name(), []record{{key, []byte("v1")}})
+
+	r, err := NewReloader(f.Name(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go r.Watch(10 * time.Millisecond)
+
+	// ensure the rewritten file's mtime differs from the original
+	time.Sleep(20 * time.Millisecond)
+	writeDB(t, f.Name(), []record{{key, []byte("v2")}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		got, err := r.Data(key)
+		if err == nil && bytes.Equal(got, []byte("v2")) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Watch did not pick up the rewritten file in time")
+}
@@ -4,10 +4,6 @@
 
 package cdb
 
-import (
-	"strconv"
-)
-
 // AppendString appends a single byte length followed by the UTF-8 bytes of
 // s to data and returns the appended slice. Will panic if len(s) exceeds
 // 255.
@@ -30,17 +26,3 @@ func ReadString(data []byte) (string, int) {
 	s := string(data[1 : slen+1])
 	return s, int(slen + 1)
 }
-
-// AppendRecord appends the (key,value) record to data and returns the
-// appended slice.
-func AppendRecord(data, key, value []byte) []byte {
-	data = append(data, '+')
-	data = strconv.AppendUint(data, uint64(len(key)), 10)
-	data = append(data, ',')
-	data = strconv.AppendUint(data, uint64(len(value)), 10)
-	data = append(data, ':')
-	data = append(data, key...)
-	data = append(data, []byte("->")...)
-	data = append(data, value...)
-	return append(data, '\n')
-}
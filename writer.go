@@ -0,0 +1,267 @@
+// Copyright 2013 Patrick Higgins.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cdb
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Writer writes a new CDB file. Records must be added with Put, and
+// Close must be called to flush the hash tables and header.
+type Writer struct {
+	w           io.WriteSeeker
+	format      format
+	pos         uint64
+	buckets     [nHeaders][]slot
+	err         error
+	bloomFPR    float64
+	bloomHashes [][2]uint64
+	bloom       *bloom
+}
+
+// slot is a (hash, pos) pair recorded for each key as it is written, to be
+// placed into its bucket's hash table when the Writer is closed.
+type slot struct {
+	hash uint64
+	pos  uint64
+}
+
+// NewWriter returns a Writer that writes a CDB file to w in the original
+// 32-bit format. w must support Seek, since the header is written last,
+// once the final position of every hash table is known.
+func NewWriter(w io.WriteSeeker) *Writer {
+	return newWriter(w, format32)
+}
+
+// NewWriter64 returns a Writer that writes w in the 64-bit cdb64 variant,
+// lifting the 4 GiB file-size limit of the original format.
+func NewWriter64(w io.WriteSeeker) *Writer {
+	return newWriter(w, format64)
+}
+
+func newWriter(w io.WriteSeeker, fm format) *Writer {
+	cw := &Writer{w: w, format: fm, pos: uint64(fm.headerSize)}
+	if _, err := w.Seek(int64(fm.headerSize), io.SeekStart); err != nil {
+		cw.err = err
+	}
+	return cw
+}
+
+// enableBloom arms cw to record the two hashes of every key put to it,
+// so Close can build a Bloom filter sized for the false positive rate
+// fpr. It must be called before the first Put.
+func (cw *Writer) enableBloom(fpr float64) {
+	cw.bloomFPR = fpr
+}
+
+// bloomFilter returns the Bloom filter built by Close, or nil if
+// enableBloom was never called.
+func (cw *Writer) bloomFilter() *bloom {
+	return cw.bloom
+}
+
+// Put appends a (key, value) record to the CDB file.
+func (cw *Writer) Put(key, value []byte) error {
+	if cw.err != nil {
+		return cw.err
+	}
+
+	fw := cw.format.fieldWidth
+	lens := make([]byte, 2*fw)
+	cw.format.putUint(lens[0:fw], uint64(len(key)))
+	cw.format.putUint(lens[fw:2*fw], uint64(len(value)))
+
+	for _, b := range [][]byte{lens, key, value} {
+		if _, err := cw.w.Write(b); err != nil {
+			cw.err = err
+			return err
+		}
+	}
+
+	hash := hashKey(key)
+	bucket := hash & 0xff
+	cw.buckets[bucket] = append(cw.buckets[bucket], slot{hash: uint64(hash), pos: cw.pos})
+	cw.pos += uint64(len(lens)) + uint64(len(key)) + uint64(len(value))
+
+	if cw.bloomFPR > 0 {
+		cw.bloomHashes = append(cw.bloomHashes, [2]uint64{uint64(hash), h2(key)})
+	}
+
+	return nil
+}
+
+// Close writes the per-bucket hash tables and the header to w. It does
+// not sync or close w.
+func (cw *Writer) Close() error {
+	if cw.err != nil {
+		return cw.err
+	}
+
+	fw := uint64(cw.format.fieldWidth)
+	sw := uint64(cw.format.slotWidth)
+
+	var header [nHeaders]tablePointer
+
+	for i, bucket := range cw.buckets {
+		nslots := uint64(2 * len(bucket))
+		header[i] = tablePointer{pos: cw.pos, nslots: nslots}
+		if nslots == 0 {
+			continue
+		}
+
+		table := make([]slot, nslots)
+		for _, s := range bucket {
+			slotIdx := (s.hash >> 8) % nslots
+			for table[slotIdx].pos != 0 {
+				slotIdx++
+				if slotIdx >= nslots {
+					slotIdx = 0
+				}
+			}
+			table[slotIdx] = s
+		}
+
+		buf := make([]byte, nslots*sw)
+		for i, s := range table {
+			off := uint64(i) * sw
+			cw.format.putUint(buf[off:off+fw], s.hash)
+			cw.format.putUint(buf[off+fw:off+sw], s.pos)
+		}
+		if _, err := cw.w.Write(buf); err != nil {
+			return err
+		}
+		cw.pos += uint64(len(buf))
+	}
+
+	if _, err := cw.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	hbuf := make([]byte, cw.format.headerSize)
+	for i, h := range header {
+		off := uint64(i) * uint64(cw.format.headerWidth)
+		cw.format.putUint(hbuf[off:off+fw], h.pos)
+		cw.format.putUint(hbuf[off+fw:off+uint64(cw.format.headerWidth)], h.nslots)
+	}
+	if _, err := cw.w.Write(hbuf); err != nil {
+		return err
+	}
+
+	if cw.bloomFPR > 0 {
+		b := newBloom(len(cw.bloomHashes), cw.bloomFPR)
+		for _, hh := range cw.bloomHashes {
+			b.add(hh[0], hh[1])
+		}
+		cw.bloom = b
+	}
+
+	return nil
+}
+
+// Create writes a new CDB file to outfile in the original 32-bit format.
+// The file is first written to a temp file in the same directory and
+// atomically renamed into place on success, so readers never observe a
+// partially written file.
+//
+// The fn callback should write records to the Writer passed to it.
+func Create(outfile string, fn func(*Writer) error) error {
+	return create(outfile, NewWriter, nil, fn)
+}
+
+// Create64 is like Create, but writes the 64-bit cdb64 variant via
+// NewWriter64.
+func Create64(outfile string, fn func(*Writer) error) error {
+	return create(outfile, NewWriter64, nil, fn)
+}
+
+// CreateOptions controls optional behavior of CreateFile.
+type CreateOptions struct {
+	// Lock causes CreateFile to hold an exclusive advisory lock on the
+	// output file from before writing until after the atomic rename, and
+	// to fsync the file before renaming. Pair this with a Reloader, whose
+	// Reload takes a shared lock while opening, so readers never map a
+	// half-written file.
+	Lock bool
+
+	// BloomFPR, if greater than zero, builds a Bloom filter sidecar
+	// (see OpenOptions.DisableBloom) at the given target false positive
+	// rate and writes it alongside outfile.
+	BloomFPR float64
+}
+
+// CreateFile is like Create, but accepts CreateOptions to control
+// optional behavior such as locking during the write.
+func CreateFile(outfile string, opts *CreateOptions, fn func(*Writer) error) error {
+	return create(outfile, NewWriter, opts, fn)
+}
+
+// Create64File is like Create64, but accepts CreateOptions to control
+// optional behavior such as locking during the write.
+func Create64File(outfile string, opts *CreateOptions, fn func(*Writer) error) error {
+	return create(outfile, NewWriter64, opts, fn)
+}
+
+func create(outfile string, newWriter func(io.WriteSeeker) *Writer, opts *CreateOptions, fn func(*Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(outfile), filepath.Base(outfile))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	locked := opts != nil && opts.Lock
+	if locked {
+		// held across the rename below: flock follows the open file
+		// description, not the path, so this lock still applies to
+		// outfile once renamed into place.
+		if err := lockFile(tmp, true); err != nil {
+			return err
+		}
+	}
+
+	w := newWriter(tmp)
+	if opts != nil && opts.BloomFPR > 0 {
+		w.enableBloom(opts.BloomFPR)
+	}
+	if err := fn(w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if locked {
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+	}
+
+	name := tmp.Name()
+	if err := os.Rename(name, outfile); err != nil {
+		return err
+	}
+
+	if locked {
+		if err := unlockFile(tmp); err != nil {
+			return err
+		}
+	}
+
+	if b := w.bloomFilter(); b != nil {
+		if err := writeBloomFile(bloomPath(outfile), b); err != nil {
+			return err
+		}
+	}
+
+	t := tmp
+	tmp = nil
+	return t.Close()
+}